@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// installationTokenRefreshBuffer is how far ahead of expires_at a cached installation
+// token is treated as stale, so it's never used right up to the edge of expiry
+const installationTokenRefreshBuffer = 5 * time.Minute
+
+// githubTransport injects a valid Authorization header into every outgoing GitHub API
+// request. It prefers a GitHub App installation token, minted from GITHUB_APP_ID,
+// GITHUB_APP_INSTALLATION_ID and GITHUB_APP_PRIVATE_KEY_PATH and rotated automatically
+// as it nears expiry, and falls back to the static GITHUB_TOKEN when those aren't set.
+type githubTransport struct {
+	base http.RoundTripper
+
+	githubURL      string
+	appID          string
+	installationID string
+	privateKeyPath string
+	staticToken    string
+
+	mu          sync.Mutex
+	cachedToken string
+	expiresAt   time.Time
+}
+
+// initGitHubClient builds the shared githubClient used for every outgoing GitHub API
+// request
+func initGitHubClient() {
+	githubURL := os.Getenv("GITHUB_URL")
+	if githubURL == "" {
+		githubURL = "https://api.github.com"
+	}
+
+	githubClient = &http.Client{Transport: newGitHubTransport(githubURL)}
+}
+
+// newGitHubTransport builds a githubTransport from the environment
+func newGitHubTransport(githubURL string) *githubTransport {
+	return &githubTransport{
+		base:           http.DefaultTransport,
+		githubURL:      githubURL,
+		appID:          os.Getenv("GITHUB_APP_ID"),
+		installationID: os.Getenv("GITHUB_APP_INSTALLATION_ID"),
+		privateKeyPath: os.Getenv("GITHUB_APP_PRIVATE_KEY_PATH"),
+		staticToken:    os.Getenv("GITHUB_TOKEN"),
+	}
+}
+
+// usesApp reports whether GitHub App credentials are configured
+func (t *githubTransport) usesApp() bool {
+	return t.appID != "" && t.installationID != "" && t.privateKeyPath != ""
+}
+
+func (t *githubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.token()
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	return t.base.RoundTrip(req)
+}
+
+// token returns a valid bearer token, minting and caching a fresh installation token
+// when GitHub App credentials are configured
+func (t *githubTransport) token() (string, error) {
+	if !t.usesApp() {
+		return t.staticToken, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.cachedToken != "" && time.Now().Before(t.expiresAt) {
+		return t.cachedToken, nil
+	}
+
+	token, expiresAt, err := fetchInstallationToken(t.githubURL, t.appID, t.installationID, t.privateKeyPath)
+	if err != nil {
+		return "", err
+	}
+
+	t.cachedToken = token
+	t.expiresAt = expiresAt.Add(-installationTokenRefreshBuffer)
+
+	return t.cachedToken, nil
+}
+
+// signAppJWT signs a short-lived RS256 JWT identifying the GitHub App, as required to
+// exchange it for an installation access token
+func signAppJWT(appID, privateKeyPath string) (string, error) {
+	keyPEM, err := os.ReadFile(privateKeyPath)
+	if err != nil {
+		return "", fmt.Errorf("error reading GitHub App private key: %w", err)
+	}
+
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(keyPEM)
+	if err != nil {
+		return "", fmt.Errorf("error parsing GitHub App private key: %w", err)
+	}
+
+	now := time.Now()
+	claims := jwt.RegisteredClaims{
+		Issuer:    appID,
+		IssuedAt:  jwt.NewNumericDate(now.Add(-60 * time.Second)), // allow for clock drift
+		ExpiresAt: jwt.NewNumericDate(now.Add(9 * time.Minute)),   // same drift margin under GitHub's 10m max
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(privateKey)
+}
+
+// fetchInstallationToken exchanges a signed App JWT for an installation access token
+func fetchInstallationToken(githubURL, appID, installationID, privateKeyPath string) (string, time.Time, error) {
+	appJWT, err := signAppJWT(appID, privateKeyPath)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	url := buildAPIURL(githubURL, fmt.Sprintf("app/installations/%s/access_tokens", installationID))
+
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", appJWT))
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", time.Time{}, fmt.Errorf("error creating installation access token: %s", resp.Status)
+	}
+
+	var body struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", time.Time{}, err
+	}
+
+	return body.Token, body.ExpiresAt, nil
+}
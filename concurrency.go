@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+var (
+	maxConcurrency int           // caps parallel repo fetches inside CountQueuedJobs
+	requestQueue   chan struct{} // admission semaphore in front of QueuedJobsHandler
+	queueTimeout   time.Duration // max time a request waits for a queue slot before a 503
+)
+
+// initConcurrencyLimits reads GITHUB_MAX_CONCURRENCY and GITHUB_QUEUE_TIMEOUT and sizes
+// the worker pool and request-admission queue accordingly
+func initConcurrencyLimits() {
+	maxConcurrency = 8
+	if v := os.Getenv("GITHUB_MAX_CONCURRENCY"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			maxConcurrency = n
+		}
+	}
+
+	queueTimeout = 5 * time.Second
+	if v := os.Getenv("GITHUB_QUEUE_TIMEOUT"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+			queueTimeout = time.Duration(secs) * time.Second
+		}
+	}
+
+	requestQueue = make(chan struct{}, maxConcurrency)
+}
+
+// acquireRequestSlot blocks until a slot in the request-admission queue frees up or
+// queueTimeout elapses, in which case it returns false and the caller should respond 503
+func acquireRequestSlot() bool {
+	select {
+	case requestQueue <- struct{}{}:
+		return true
+	case <-time.After(queueTimeout):
+		return false
+	}
+}
+
+// releaseRequestSlot frees a slot acquired via acquireRequestSlot
+func releaseRequestSlot() {
+	<-requestQueue
+}
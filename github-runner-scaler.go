@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -10,6 +11,10 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
 )
 
 // Repo represents a GitHub repository
@@ -19,14 +24,26 @@ type Repo struct {
 
 // WorkflowRun represents a workflow run in a GitHub repository
 type WorkflowRun struct {
+	ID     int64  `json:"id"`
 	Status string `json:"status"`
 }
 
+// Job represents a single job within a workflow run
+type Job struct {
+	ID     int64    `json:"id"`
+	Status string   `json:"status"`
+	Labels []string `json:"labels"`
+}
+
 var (
-	cacheLock      sync.Mutex // To handle concurrency
-	cachedJobs     int
+	cacheLock      sync.Mutex // Guards lastUpdateTime/livePolled (the live map has its own lock)
+	livePolled     bool       // true once the live map has been seeded by at least one poll
 	lastUpdateTime time.Time
-	cacheTimeout   time.Duration
+	cacheTimeout   time.Duration // now doubles as the webhook drift-check interval
+
+	githubClient *http.Client // shared client that authenticates every outgoing GitHub API request
+
+	pollGroup singleflight.Group // dedupes concurrent cache-miss polls into a single GitHub fetch
 )
 
 // Detect whether the API is public GitHub or GitHub Enterprise, and adjust the endpoint accordingly
@@ -41,138 +58,254 @@ func buildAPIURL(baseURL, endpoint string) string {
 	return fmt.Sprintf("%s/api/v3/%s", strings.TrimSuffix(baseURL, "/"), endpoint)
 }
 
-// GetRepos fetches the repositories for the given organization
-func GetRepos(githubURL, org, token string) ([]Repo, error) {
+// GetRepos fetches every repository for the given organization, following pagination
+func GetRepos(githubURL, org string) ([]Repo, error) {
 	url := buildAPIURL(githubURL, fmt.Sprintf("orgs/%s/repos", org))
 
-	req, err := http.NewRequest("GET", url, nil)
+	var repos []Repo
+	err := paginate(url, "repos", func(body io.Reader) error {
+		var page []Repo
+		if err := json.NewDecoder(body).Decode(&page); err != nil {
+			return err
+		}
+		repos = append(repos, page...)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-	req.Header.Set("Accept", "application/vnd.github+json")
-	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	return repos, nil
+}
+
+// GetWorkflowRuns fetches every workflow run with the given status for a specific
+// repository, following pagination. Filtering server-side means pagination stops as
+// soon as a repo runs out of matching runs, instead of walking its entire run history.
+func GetWorkflowRuns(githubURL, repo, status string) ([]WorkflowRun, error) {
+	url := buildAPIURL(githubURL, fmt.Sprintf("repos/%s/actions/runs?status=%s", repo, status))
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	var workflowRuns []WorkflowRun
+	err := paginate(url, "runs", func(body io.Reader) error {
+		var page struct {
+			WorkflowRuns []WorkflowRun `json:"workflow_runs"`
+		}
+		if err := json.NewDecoder(body).Decode(&page); err != nil {
+			return err
+		}
+		workflowRuns = append(workflowRuns, page.WorkflowRuns...)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("error fetching repos: %s", resp.Status)
-	}
+	return workflowRuns, nil
+}
 
-	var repos []Repo
-	if err := json.NewDecoder(resp.Body).Decode(&repos); err != nil {
+// GetWorkflowRunJobs fetches every job belonging to a single workflow run, following
+// pagination. Matrix runs routinely have more than the default 30-per-page jobs, so
+// this has to paginate just like GetRepos/GetWorkflowRuns.
+func GetWorkflowRunJobs(githubURL, repo string, runID int64) ([]Job, error) {
+	url := buildAPIURL(githubURL, fmt.Sprintf("repos/%s/actions/runs/%d/jobs", repo, runID))
+
+	var jobs []Job
+	err := paginate(url, "jobs", func(body io.Reader) error {
+		var page struct {
+			Jobs []Job `json:"jobs"`
+		}
+		if err := json.NewDecoder(body).Decode(&page); err != nil {
+			return err
+		}
+		jobs = append(jobs, page.Jobs...)
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	return repos, nil
+	return jobs, nil
 }
 
-// GetWorkflowRuns fetches the workflow runs for a specific repository
-func GetWorkflowRuns(githubURL, repo, token string) ([]WorkflowRun, error) {
-	url := buildAPIURL(githubURL, fmt.Sprintf("repos/%s/actions/runs", repo))
+// labelsKey builds the map key used to group queued jobs by their runner labels
+func labelsKey(labels []string) string {
+	return strings.Join(labels, ",")
+}
 
-	req, err := http.NewRequest("GET", url, nil)
+// CountQueuedJobs counts the queued jobs across all repositories in the org, grouped
+// by the runner labels each job requests. It also returns the labels key for each
+// individual queued job, keyed by job ID, so the webhook live map can be reseeded with
+// exactly the jobs a poll observed as queued. Repos are fetched concurrently, up to
+// maxConcurrency at a time, so one slow or large org doesn't stall the cache past its
+// timeout.
+func CountQueuedJobs(githubURL, org string) (map[string]int, map[int64]string, error) {
+	repos, err := GetRepos(githubURL, org)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-	req.Header.Set("Accept", "application/vnd.github+json")
-	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	var mu sync.Mutex
+	queuedByLabels := make(map[string]int)
+	queuedJobLabels := make(map[int64]string)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+	g := new(errgroup.Group)
+	g.SetLimit(maxConcurrency)
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("error fetching workflow runs: %s", resp.Status)
-	}
+	for _, repo := range repos {
+		repo := repo
+		g.Go(func() error {
+			repoByLabels, repoJobLabels, err := countRepoQueuedJobs(githubURL, repo.FullName)
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			for key, count := range repoByLabels {
+				queuedByLabels[key] += count
+			}
+			for jobID, key := range repoJobLabels {
+				queuedJobLabels[jobID] = key
+			}
+			mu.Unlock()
 
-	var workflowRuns struct {
-		WorkflowRuns []WorkflowRun `json:"workflow_runs"`
+			return nil
+		})
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&workflowRuns); err != nil {
-		return nil, err
+
+	if err := g.Wait(); err != nil {
+		return nil, nil, err
 	}
 
-	return workflowRuns.WorkflowRuns, nil
+	return queuedByLabels, queuedJobLabels, nil
 }
 
-// CountQueuedJobs counts the total number of queued jobs across all repositories
-func CountQueuedJobs(githubURL, org, token string) (int, error) {
-	repos, err := GetRepos(githubURL, org, token)
+// countRepoQueuedJobs counts the queued jobs for a single repository, grouped by labels,
+// and returns the labels key for each queued job by job ID. A run's overall status flips
+// to in_progress as soon as its first job starts, even while other jobs in that same run
+// (matrix legs, or jobs gated on a dependency) are still queued, so both queued and
+// in_progress runs have to be inspected for jobs.
+func countRepoQueuedJobs(githubURL, repoFullName string) (map[string]int, map[int64]string, error) {
+	queuedRuns, err := GetWorkflowRuns(githubURL, repoFullName, "queued")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inProgressRuns, err := GetWorkflowRuns(githubURL, repoFullName, "in_progress")
 	if err != nil {
-		return 0, err
+		return nil, nil, err
 	}
 
-	totalQueuedJobs := 0
+	queuedByLabels := make(map[string]int)
+	queuedJobLabels := make(map[int64]string)
 
-	for _, repo := range repos {
-		workflowRuns, err := GetWorkflowRuns(githubURL, repo.FullName, token)
+	for _, run := range append(queuedRuns, inProgressRuns...) {
+		jobs, err := GetWorkflowRunJobs(githubURL, repoFullName, run.ID)
 		if err != nil {
-			return 0, err
+			return nil, nil, err
 		}
 
-		for _, run := range workflowRuns {
-			if run.Status == "queued" {
-				totalQueuedJobs++
+		for _, job := range jobs {
+			if job.Status == "queued" {
+				key := labelsKey(job.Labels)
+				queuedByLabels[key]++
+				queuedJobLabels[job.ID] = key
 			}
 		}
 	}
 
-	return totalQueuedJobs, nil
+	return queuedByLabels, queuedJobLabels, nil
 }
 
-// API handler to expose the queued jobs count with caching
-func QueuedJobsHandler(w http.ResponseWriter, r *http.Request) {
-	githubURL := os.Getenv("GITHUB_URL")
-	org := os.Getenv("GITHUB_ORGANIZATION")
-	token := os.Getenv("GITHUB_TOKEN")
-
-	if githubURL == "" {
-		githubURL = "https://api.github.com"
+// totalQueued sums the queued job count across all label groups
+func totalQueued(byLabels map[string]int) int {
+	total := 0
+	for _, count := range byLabels {
+		total += count
 	}
+	return total
+}
 
+// API handler to expose the queued jobs count, broken down by runner labels.
+// A `labels` query parameter (e.g. ?labels=self-hosted,linux,gpu) narrows the response to
+// the queued job count for that exact label set, which is what a KEDA metrics-api scaler
+// polls per runner pool.
+//
+// Under normal operation this reads straight from the in-memory map kept up to date by
+// WebhookHandler, with no upstream API call. It only falls back to a full poll on cold
+// start (nothing received yet) or once the drift-check interval has elapsed, to correct
+// for any webhook deliveries GitHub failed to send.
+func QueuedJobsHandler(w http.ResponseWriter, r *http.Request) {
 	cacheLock.Lock()
-	defer cacheLock.Unlock()
+	needsPoll := !livePolled || time.Since(lastUpdateTime) >= cacheTimeout
+	cacheLock.Unlock()
 
-	// Check if the cache is still valid
-	if time.Since(lastUpdateTime) < cacheTimeout {
-		log.Println("Returning cached result")
-		response := map[string]int{
-			"queued_jobs": cachedJobs,
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
+	if !needsPoll {
+		cacheHitsTotal.Inc()
+		writeQueuedJobsResponse(w, r, snapshotLiveByLabels())
+		return
+	}
+
+	// The admission semaphore only needs to bound the poll path below, which is the
+	// one that makes upstream GitHub calls. The cache-hit path above never reaches
+	// here, so ordinary polling traffic can't be rejected with a spurious 503.
+	if !acquireRequestSlot() {
+		http.Error(w, "too many concurrent requests, try again later", http.StatusServiceUnavailable)
 		return
 	}
+	defer releaseRequestSlot()
+
+	cacheMissesTotal.Inc()
+
+	// Concurrent requests hitting a miss at the same time (cold start, or right when
+	// the drift-check interval elapses under load) share a single poll via pollGroup,
+	// instead of each independently fanning out up to maxConcurrency GitHub calls.
+	result, err, _ := pollGroup.Do("poll", func() (interface{}, error) {
+		githubURL := os.Getenv("GITHUB_URL")
+		org := os.Getenv("GITHUB_ORGANIZATION")
 
-	// Otherwise, compute the queued jobs and update the cache
-	queuedJobs, err := CountQueuedJobs(githubURL, org, token)
+		if githubURL == "" {
+			githubURL = "https://api.github.com"
+		}
+
+		queuedByLabels, queuedJobLabels, err := CountQueuedJobs(githubURL, org)
+		if err != nil {
+			return nil, err
+		}
+
+		resetLiveByLabels(queuedByLabels, queuedJobLabels)
+
+		cacheLock.Lock()
+		livePolled = true
+		lastUpdateTime = time.Now()
+		cacheLock.Unlock()
+
+		return queuedByLabels, nil
+	})
 	if err != nil {
 		http.Error(w, fmt.Sprintf("error counting queued jobs: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	// Update cache
-	cachedJobs = queuedJobs
-	lastUpdateTime = time.Now()
+	queuedByLabels := result.(map[string]int)
 
-	// Respond with the updated count in JSON format
-	response := map[string]int{
-		"queued_jobs": queuedJobs,
-	}
+	writeQueuedJobsResponse(w, r, queuedByLabels)
+}
+
+// writeQueuedJobsResponse renders the queued job counts as JSON, scoped to the `labels`
+// query parameter when present.
+func writeQueuedJobsResponse(w http.ResponseWriter, r *http.Request, byLabels map[string]int) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+
+	if labels := r.URL.Query().Get("labels"); labels != "" {
+		json.NewEncoder(w).Encode(map[string]int{
+			"queued_jobs": byLabels[labels],
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"queued_jobs": totalQueued(byLabels),
+		"by_labels":   byLabels,
+	})
 }
 
 func main() {
@@ -190,8 +323,13 @@ func main() {
 
 	cacheTimeout = time.Duration(timeout) * time.Second
 
-	// Set up the HTTP server and route
+	initConcurrencyLimits()
+	initGitHubClient()
+
+	// Set up the HTTP server and routes
 	http.HandleFunc("/queued_jobs", QueuedJobsHandler)
+	http.HandleFunc("/webhook", WebhookHandler)
+	http.Handle("/metrics", promhttp.Handler())
 
 	port := os.Getenv("PORT")
 	if port == "" {
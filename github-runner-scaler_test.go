@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// stubGitHubServer serves GetRepos/GetWorkflowRuns/GetWorkflowRunJobs for a single
+// repository out of fixed in-memory data, with no pagination (pagination itself is
+// covered by TestParseNextLink). jobsByRun is keyed by run ID.
+func stubGitHubServer(t *testing.T, repos []Repo, queuedRuns, inProgressRuns []WorkflowRun, jobsByRun map[int64][]Job) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case r.URL.Path == "/api/v3/orgs/acme/repos":
+			json.NewEncoder(w).Encode(repos)
+		case r.URL.Path == "/api/v3/repos/acme/widgets/actions/runs" && r.URL.Query().Get("status") == "queued":
+			json.NewEncoder(w).Encode(map[string][]WorkflowRun{"workflow_runs": queuedRuns})
+		case r.URL.Path == "/api/v3/repos/acme/widgets/actions/runs" && r.URL.Query().Get("status") == "in_progress":
+			json.NewEncoder(w).Encode(map[string][]WorkflowRun{"workflow_runs": inProgressRuns})
+		default:
+			var runID int64
+			if n, _ := fmt.Sscanf(r.URL.Path, "/api/v3/repos/acme/widgets/actions/runs/%d/jobs", &runID); n == 1 {
+				json.NewEncoder(w).Encode(map[string][]Job{"jobs": jobsByRun[runID]})
+				return
+			}
+			t.Fatalf("unexpected request: %s %s", r.Method, r.URL)
+		}
+	}))
+
+	githubClient = server.Client()
+	maxConcurrency = 8
+
+	return server
+}
+
+func TestCountRepoQueuedJobs(t *testing.T) {
+	server := stubGitHubServer(t, nil,
+		[]WorkflowRun{{ID: 1, Status: "queued"}},
+		[]WorkflowRun{{ID: 2, Status: "in_progress"}},
+		map[int64][]Job{
+			1: {
+				{ID: 10, Status: "queued", Labels: []string{"self-hosted", "linux"}},
+				{ID: 11, Status: "queued", Labels: []string{"self-hosted", "linux"}},
+			},
+			2: {
+				// Run 2 is in_progress overall, but one matrix leg is still queued.
+				{ID: 20, Status: "in_progress", Labels: []string{"self-hosted", "linux"}},
+				{ID: 21, Status: "queued", Labels: []string{"self-hosted", "gpu"}},
+			},
+		})
+	defer server.Close()
+
+	byLabels, jobLabels, err := countRepoQueuedJobs(server.URL, "acme/widgets")
+	if err != nil {
+		t.Fatalf("countRepoQueuedJobs() error = %v", err)
+	}
+
+	wantByLabels := map[string]int{"self-hosted,linux": 2, "self-hosted,gpu": 1}
+	if len(byLabels) != len(wantByLabels) {
+		t.Fatalf("byLabels = %v, want %v", byLabels, wantByLabels)
+	}
+	for key, count := range wantByLabels {
+		if byLabels[key] != count {
+			t.Errorf("byLabels[%q] = %d, want %d", key, byLabels[key], count)
+		}
+	}
+
+	wantJobLabels := map[int64]string{10: "self-hosted,linux", 11: "self-hosted,linux", 21: "self-hosted,gpu"}
+	if len(jobLabels) != len(wantJobLabels) {
+		t.Fatalf("jobLabels = %v, want %v", jobLabels, wantJobLabels)
+	}
+	for jobID, key := range wantJobLabels {
+		if jobLabels[jobID] != key {
+			t.Errorf("jobLabels[%d] = %q, want %q", jobID, jobLabels[jobID], key)
+		}
+	}
+}
+
+func TestCountQueuedJobs(t *testing.T) {
+	server := stubGitHubServer(t,
+		[]Repo{{FullName: "acme/widgets"}},
+		[]WorkflowRun{{ID: 1, Status: "queued"}},
+		nil,
+		map[int64][]Job{
+			1: {{ID: 10, Status: "queued", Labels: []string{"self-hosted", "linux"}}},
+		})
+	defer server.Close()
+
+	byLabels, jobLabels, err := CountQueuedJobs(server.URL, "acme")
+	if err != nil {
+		t.Fatalf("CountQueuedJobs() error = %v", err)
+	}
+
+	if got := byLabels["self-hosted,linux"]; got != 1 {
+		t.Errorf("byLabels[self-hosted,linux] = %d, want 1", got)
+	}
+	if got := jobLabels[10]; got != "self-hosted,linux" {
+		t.Errorf("jobLabels[10] = %q, want %q", got, "self-hosted,linux")
+	}
+}
+
+func TestLabelsKey(t *testing.T) {
+	cases := []struct {
+		name   string
+		labels []string
+		want   string
+	}{
+		{name: "multiple labels", labels: []string{"self-hosted", "linux", "gpu"}, want: "self-hosted,linux,gpu"},
+		{name: "single label", labels: []string{"self-hosted"}, want: "self-hosted"},
+		{name: "no labels", labels: nil, want: ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := labelsKey(c.labels); got != c.want {
+				t.Errorf("labelsKey(%v) = %q, want %q", c.labels, got, c.want)
+			}
+		})
+	}
+}
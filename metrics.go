@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	queuedJobsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "github_runner_queued_jobs",
+			Help: "Number of queued GitHub Actions jobs, grouped by requested runner labels",
+		},
+		[]string{"labels"},
+	)
+
+	apiCallsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "github_runner_scaler_api_calls_total",
+			Help: "Total GitHub API calls made by the scaler, by endpoint and response status",
+		},
+		[]string{"endpoint", "status"},
+	)
+
+	apiLatencySeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "github_runner_scaler_api_latency_seconds",
+			Help:    "Latency of GitHub API calls made by the scaler, by endpoint",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"endpoint"},
+	)
+
+	cacheHitsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "github_runner_scaler_cache_hits_total",
+		Help: "Number of /queued_jobs requests served from the live map without polling GitHub",
+	})
+
+	cacheMissesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "github_runner_scaler_cache_misses_total",
+		Help: "Number of /queued_jobs requests that triggered a full poll of the GitHub API",
+	})
+
+	rateLimitRemainingGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "github_ratelimit_remaining",
+		Help: "Remaining GitHub REST API rate limit budget, parsed from X-RateLimit-Remaining",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		queuedJobsGauge,
+		apiCallsTotal,
+		apiLatencySeconds,
+		cacheHitsTotal,
+		cacheMissesTotal,
+		rateLimitRemainingGauge,
+	)
+}
+
+// recordAPICall records the outcome of a single GitHub API call for the /metrics endpoint
+func recordAPICall(endpoint string, start time.Time, resp *http.Response) {
+	apiCallsTotal.WithLabelValues(endpoint, strconv.Itoa(resp.StatusCode)).Inc()
+	apiLatencySeconds.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+
+	if remaining := resp.Header.Get("X-RateLimit-Remaining"); remaining != "" {
+		if n, err := strconv.Atoi(remaining); err == nil {
+			rateLimitRemainingGauge.Set(float64(n))
+		}
+	}
+}
+
+// recordQueuedJobs replaces the queued-jobs gauge wholesale to match the latest known counts
+func recordQueuedJobs(byLabels map[string]int) {
+	queuedJobsGauge.Reset()
+	for labels, count := range byLabels {
+		queuedJobsGauge.WithLabelValues(labels).Set(float64(count))
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRateLimitRetries caps how many times a request is retried after hitting a secondary
+// rate limit before giving up
+const maxRateLimitRetries = 5
+
+// doGitHubRequest sends a GitHub API request through githubClient, which injects
+// authentication, retrying with exponential backoff when the response indicates a
+// secondary rate limit, honoring Retry-After and X-RateLimit-Reset if present. endpoint
+// is a low-cardinality label (e.g. "repos", "runs", "jobs") used to tag the
+// api_calls/api_latency metrics.
+func doGitHubRequest(req *http.Request, endpoint string) (*http.Response, error) {
+	backoff := time.Second
+
+	for attempt := 0; attempt < maxRateLimitRetries; attempt++ {
+		start := time.Now()
+		resp, err := githubClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		recordAPICall(endpoint, start, resp)
+
+		if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+			return resp, nil
+		}
+
+		wait := rateLimitWait(resp.Header, backoff)
+		resp.Body.Close()
+
+		log.Printf("rate limited fetching %s, retrying in %s", req.URL, wait)
+		time.Sleep(wait)
+		backoff *= 2
+	}
+
+	return nil, fmt.Errorf("exhausted retries fetching %s after repeated rate limiting", req.URL)
+}
+
+// rateLimitWait determines how long to wait before retrying a rate-limited request,
+// preferring Retry-After, then X-RateLimit-Reset, and finally falling back to backoff
+func rateLimitWait(header http.Header, backoff time.Duration) time.Duration {
+	if retryAfter := header.Get("Retry-After"); retryAfter != "" {
+		if secs, err := strconv.Atoi(retryAfter); err == nil {
+			return time.Duration(secs) * time.Second
+		}
+	}
+
+	if reset := header.Get("X-RateLimit-Reset"); reset != "" {
+		if unix, err := strconv.ParseInt(reset, 10, 64); err == nil {
+			if wait := time.Until(time.Unix(unix, 0)); wait > 0 {
+				return wait
+			}
+		}
+	}
+
+	return backoff
+}
+
+// parseNextLink extracts the rel="next" URL from an RFC 5988 Link header, returning ""
+// once there are no more pages
+func parseNextLink(linkHeader string) string {
+	for _, part := range strings.Split(linkHeader, ",") {
+		segments := strings.Split(strings.TrimSpace(part), ";")
+		if len(segments) < 2 {
+			continue
+		}
+
+		url := strings.Trim(strings.TrimSpace(segments[0]), "<>")
+		for _, seg := range segments[1:] {
+			if strings.TrimSpace(seg) == `rel="next"` {
+				return url
+			}
+		}
+	}
+
+	return ""
+}
+
+// withPerPage appends per_page=100 to a URL that may or may not already have a query string
+func withPerPage(url string) string {
+	separator := "?"
+	if strings.Contains(url, "?") {
+		separator = "&"
+	}
+	return fmt.Sprintf("%s%sper_page=100", url, separator)
+}
+
+// paginate walks every page of a GitHub API list endpoint starting at url, decoding each
+// page's body with decodePage and following the Link header's rel="next" until exhausted
+func paginate(url, endpoint string, decodePage func(body io.Reader) error) error {
+	nextURL := withPerPage(url)
+
+	for nextURL != "" {
+		req, err := http.NewRequest("GET", nextURL, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := doGitHubRequest(req, endpoint)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return fmt.Errorf("error fetching %s: %s", nextURL, resp.Status)
+		}
+
+		err = decodePage(resp.Body)
+		nextURL = parseNextLink(resp.Header.Get("Link"))
+		resp.Body.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseNextLink(t *testing.T) {
+	cases := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{
+			name:   "next and last",
+			header: `<https://api.github.com/orgs/foo/repos?page=2>; rel="next", <https://api.github.com/orgs/foo/repos?page=5>; rel="last"`,
+			want:   "https://api.github.com/orgs/foo/repos?page=2",
+		},
+		{
+			name:   "only last, no next",
+			header: `<https://api.github.com/orgs/foo/repos?page=5>; rel="last"`,
+			want:   "",
+		},
+		{
+			name:   "empty header",
+			header: "",
+			want:   "",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := parseNextLink(c.header); got != c.want {
+				t.Errorf("parseNextLink(%q) = %q, want %q", c.header, got, c.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitWaitPrefersRetryAfter(t *testing.T) {
+	header := http.Header{}
+	header.Set("Retry-After", "30")
+	header.Set("X-RateLimit-Reset", "9999999999")
+
+	got := rateLimitWait(header, time.Second)
+	if got != 30*time.Second {
+		t.Errorf("rateLimitWait() = %s, want 30s", got)
+	}
+}
+
+func TestRateLimitWaitFallsBackToRateLimitReset(t *testing.T) {
+	reset := time.Now().Add(45 * time.Second)
+	header := http.Header{}
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+
+	got := rateLimitWait(header, time.Second)
+	if got <= 0 || got > 45*time.Second {
+		t.Errorf("rateLimitWait() = %s, want a positive duration up to 45s", got)
+	}
+}
+
+func TestRateLimitWaitFallsBackToBackoff(t *testing.T) {
+	header := http.Header{}
+
+	got := rateLimitWait(header, 4*time.Second)
+	if got != 4*time.Second {
+		t.Errorf("rateLimitWait() = %s, want 4s", got)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// WorkflowJobEvent is the payload GitHub sends for workflow_job webhook events
+type WorkflowJobEvent struct {
+	Action      string `json:"action"`
+	WorkflowJob struct {
+		ID     int64    `json:"id"`
+		Status string   `json:"status"`
+		Labels []string `json:"labels"`
+	} `json:"workflow_job"`
+}
+
+var (
+	liveLock      sync.Mutex
+	liveByLabels  = make(map[string]int)
+	liveJobLabels = make(map[int64]string)
+)
+
+// maxWebhookBodyBytes bounds how much of a webhook request body is read before the
+// signature is even checked, so an unauthenticated caller can't exhaust memory by
+// POSTing an oversized body to /webhook. GitHub's payloads are well under this.
+const maxWebhookBodyBytes = 5 << 20 // 5 MiB
+
+// verifySignature checks the X-Hub-Signature-256 header against the configured webhook
+// secret using a constant-time comparison
+func verifySignature(secret string, body []byte, signatureHeader string) bool {
+	if secret == "" || signatureHeader == "" {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(expected), []byte(signatureHeader))
+}
+
+// WebhookHandler receives GitHub workflow_job and workflow_run events and keeps the
+// in-memory queued-jobs map up to date, so QueuedJobsHandler can serve most requests
+// without calling the GitHub API at all.
+func WebhookHandler(w http.ResponseWriter, r *http.Request) {
+	secret := os.Getenv("GITHUB_WEBHOOK_SECRET")
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxWebhookBodyBytes)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "error reading request body", http.StatusBadRequest)
+		return
+	}
+
+	if !verifySignature(secret, body, r.Header.Get("X-Hub-Signature-256")) {
+		http.Error(w, "invalid webhook signature", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Header.Get("X-GitHub-Event") {
+	case "workflow_job":
+		var event WorkflowJobEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			http.Error(w, "error decoding webhook payload", http.StatusBadRequest)
+			return
+		}
+		applyWorkflowJobEvent(event)
+	case "workflow_run":
+		// workflow_run events carry no per-job labels, so there's nothing to apply here;
+		// drift-check polling is what reconciles against runs that slipped through.
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// applyWorkflowJobEvent updates the live queued-jobs map based on a job's lifecycle:
+// queued jobs are added to their label group, and jobs that start running or finish
+// are removed from it.
+func applyWorkflowJobEvent(event WorkflowJobEvent) {
+	liveLock.Lock()
+	defer liveLock.Unlock()
+
+	jobID := event.WorkflowJob.ID
+
+	switch event.Action {
+	case "queued":
+		key := labelsKey(event.WorkflowJob.Labels)
+		liveJobLabels[jobID] = key
+		liveByLabels[key]++
+		queuedJobsGauge.WithLabelValues(key).Set(float64(liveByLabels[key]))
+	case "in_progress", "completed":
+		if key, ok := liveJobLabels[jobID]; ok {
+			liveByLabels[key]--
+			if liveByLabels[key] <= 0 {
+				delete(liveByLabels, key)
+			}
+			delete(liveJobLabels, jobID)
+			queuedJobsGauge.WithLabelValues(key).Set(float64(liveByLabels[key]))
+		}
+	}
+}
+
+// snapshotLiveByLabels returns a copy of the live queued-jobs map so callers can read it
+// without holding liveLock
+func snapshotLiveByLabels() map[string]int {
+	liveLock.Lock()
+	defer liveLock.Unlock()
+
+	snapshot := make(map[string]int, len(liveByLabels))
+	for key, count := range liveByLabels {
+		snapshot[key] = count
+	}
+	return snapshot
+}
+
+// resetLiveByLabels replaces the live queued-jobs map wholesale, used after a full poll
+// reconciles it against the GitHub API. jobLabels reseeds liveJobLabels with exactly the
+// jobs the poll observed as queued, so a later in_progress/completed webhook for one of
+// them still finds an entry to decrement instead of silently no-oping: GitHub only sends
+// the "queued" action once per job, and a job queued before this poll will never get
+// another one.
+func resetLiveByLabels(byLabels map[string]int, jobLabels map[int64]string) {
+	liveLock.Lock()
+	defer liveLock.Unlock()
+
+	liveJobLabels = jobLabels
+	liveByLabels = byLabels
+
+	recordQueuedJobs(byLabels)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+// resetLiveState clears the package-level live maps so each test starts from a known,
+// empty state regardless of test execution order
+func resetLiveState() {
+	liveLock.Lock()
+	defer liveLock.Unlock()
+
+	liveByLabels = make(map[string]int)
+	liveJobLabels = make(map[int64]string)
+}
+
+func jobEvent(action string, jobID int64, labels ...string) WorkflowJobEvent {
+	var event WorkflowJobEvent
+	event.Action = action
+	event.WorkflowJob.ID = jobID
+	event.WorkflowJob.Labels = labels
+	return event
+}
+
+func TestVerifySignature(t *testing.T) {
+	secret := "test-secret"
+	body := []byte(`{"action":"queued"}`)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	validSignature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	cases := []struct {
+		name      string
+		secret    string
+		body      []byte
+		signature string
+		want      bool
+	}{
+		{name: "valid signature", secret: secret, body: body, signature: validSignature, want: true},
+		{name: "wrong secret", secret: "other-secret", body: body, signature: validSignature, want: false},
+		{name: "tampered body", secret: secret, body: []byte(`{"action":"completed"}`), signature: validSignature, want: false},
+		{name: "empty secret", secret: "", body: body, signature: validSignature, want: false},
+		{name: "empty signature header", secret: secret, body: body, signature: "", want: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := verifySignature(c.secret, c.body, c.signature); got != c.want {
+				t.Errorf("verifySignature() = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestApplyWorkflowJobEvent(t *testing.T) {
+	cases := []struct {
+		name          string
+		events        []WorkflowJobEvent
+		wantByLabels  map[string]int
+		wantJobLabels map[int64]string
+	}{
+		{
+			name:          "queued increments its label group",
+			events:        []WorkflowJobEvent{jobEvent("queued", 1, "self-hosted", "linux")},
+			wantByLabels:  map[string]int{"self-hosted,linux": 1},
+			wantJobLabels: map[int64]string{1: "self-hosted,linux"},
+		},
+		{
+			name: "in_progress decrements and removes the job",
+			events: []WorkflowJobEvent{
+				jobEvent("queued", 1, "self-hosted", "linux"),
+				jobEvent("in_progress", 1, "self-hosted", "linux"),
+			},
+			wantByLabels:  map[string]int{},
+			wantJobLabels: map[int64]string{},
+		},
+		{
+			name: "completed decrements and removes the job",
+			events: []WorkflowJobEvent{
+				jobEvent("queued", 1, "self-hosted", "linux"),
+				jobEvent("completed", 1, "self-hosted", "linux"),
+			},
+			wantByLabels:  map[string]int{},
+			wantJobLabels: map[int64]string{},
+		},
+		{
+			name: "duplicate completed delivery is a no-op, no negative count",
+			events: []WorkflowJobEvent{
+				jobEvent("queued", 1, "self-hosted", "linux"),
+				jobEvent("completed", 1, "self-hosted", "linux"),
+				jobEvent("completed", 1, "self-hosted", "linux"),
+			},
+			wantByLabels:  map[string]int{},
+			wantJobLabels: map[int64]string{},
+		},
+		{
+			name: "other jobs in the same label group are unaffected",
+			events: []WorkflowJobEvent{
+				jobEvent("queued", 1, "self-hosted", "linux"),
+				jobEvent("queued", 2, "self-hosted", "linux"),
+				jobEvent("completed", 1, "self-hosted", "linux"),
+			},
+			wantByLabels:  map[string]int{"self-hosted,linux": 1},
+			wantJobLabels: map[int64]string{2: "self-hosted,linux"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resetLiveState()
+			defer resetLiveState()
+
+			for _, event := range c.events {
+				applyWorkflowJobEvent(event)
+			}
+
+			liveLock.Lock()
+			defer liveLock.Unlock()
+
+			if len(liveByLabels) != len(c.wantByLabels) {
+				t.Fatalf("liveByLabels = %v, want %v", liveByLabels, c.wantByLabels)
+			}
+			for key, count := range c.wantByLabels {
+				if liveByLabels[key] != count {
+					t.Errorf("liveByLabels[%q] = %d, want %d", key, liveByLabels[key], count)
+				}
+			}
+
+			if len(liveJobLabels) != len(c.wantJobLabels) {
+				t.Fatalf("liveJobLabels = %v, want %v", liveJobLabels, c.wantJobLabels)
+			}
+			for jobID, key := range c.wantJobLabels {
+				if liveJobLabels[jobID] != key {
+					t.Errorf("liveJobLabels[%d] = %q, want %q", jobID, liveJobLabels[jobID], key)
+				}
+			}
+		})
+	}
+}
+
+// TestResetLiveByLabelsReseedsJobLabels guards against the reconciliation bug where a
+// full poll wiped liveJobLabels to empty: a job already queued at poll time would then
+// never decrement on its later in_progress/completed webhook, since GitHub only sends
+// the "queued" action once per job.
+func TestResetLiveByLabelsReseedsJobLabels(t *testing.T) {
+	resetLiveState()
+	defer resetLiveState()
+
+	// Simulate a poll that observed job 1 as already queued.
+	resetLiveByLabels(
+		map[string]int{"self-hosted,linux": 1},
+		map[int64]string{1: "self-hosted,linux"},
+	)
+
+	// The webhook for that same job's later transition arrives, with no intervening
+	// "queued" delivery.
+	applyWorkflowJobEvent(jobEvent("in_progress", 1, "self-hosted", "linux"))
+
+	liveLock.Lock()
+	defer liveLock.Unlock()
+
+	if count, ok := liveByLabels["self-hosted,linux"]; ok {
+		t.Errorf("liveByLabels[%q] = %d, want label group removed", "self-hosted,linux", count)
+	}
+	if _, ok := liveJobLabels[1]; ok {
+		t.Errorf("liveJobLabels[1] still present, want removed after in_progress")
+	}
+}